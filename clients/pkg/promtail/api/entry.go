@@ -0,0 +1,20 @@
+package api
+
+import (
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// Entry is a log entry with labels.
+type Entry struct {
+	Labels    model.LabelSet
+	Timestamp time.Time
+	Line      string
+}
+
+// EntryHandler is something that can handle an entry.
+type EntryHandler interface {
+	Chan() chan<- Entry
+	Stop()
+}
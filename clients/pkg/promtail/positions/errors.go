@@ -0,0 +1,14 @@
+package positions
+
+import "errors"
+
+// ErrPositionsLocked is returned by New when cfg.LockMode requires a lock on
+// the positions file and that lock could not be acquired within
+// cfg.LockTimeout, typically because another promtail instance already holds
+// a lock on it (e.g. during a DaemonSet rollout or an accidental double-start).
+//
+// Callers can treat this as fatal, or retry New with LockMode set to
+// LockModeNone and ReadOnly set to true to keep tailing files without
+// persisting positions. A retry with LockModeSharedReadOnly fails the same
+// way while the other instance holds an exclusive lock.
+var ErrPositionsLocked = errors.New("positions file is locked by another promtail instance")
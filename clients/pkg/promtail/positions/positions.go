@@ -0,0 +1,256 @@
+// Package positions is used to store file positions/offsets in a yaml file so that
+// tailers can resume from where they left off after a restart.
+package positions
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"gopkg.in/yaml.v2"
+)
+
+// LockMode controls whether and how positions.New takes an advisory lock on
+// the positions file before using it.
+type LockMode string
+
+const (
+	// LockModeNone takes no lock at all, the historical behaviour. Safe only
+	// when a single promtail instance ever touches a given positions file.
+	LockModeNone LockMode = "none"
+	// LockModeExclusive takes an exclusive lock, failing New with
+	// ErrPositionsLocked if another instance already holds any lock on the
+	// file.
+	LockModeExclusive LockMode = "exclusive"
+	// LockModeSharedReadOnly takes a shared lock, which coexists with other
+	// shared-lock holders but not with an exclusive one. Intended to be
+	// paired with Config.ReadOnly so a standby instance can keep tailing
+	// files without persisting positions.
+	LockModeSharedReadOnly LockMode = "shared-readonly"
+)
+
+// Config describes where to get position information from for restarts.
+type Config struct {
+	SyncPeriod        time.Duration `yaml:"sync_period"`
+	PositionsFile     string        `yaml:"filename"`
+	IgnoreInvalidYaml bool          `yaml:"ignore_invalid_yaml"`
+	ReadOnly          bool          `yaml:"-"`
+
+	// LockMode selects whether New takes an advisory lock on PositionsFile,
+	// and whether that lock is exclusive or shared. Defaults to
+	// LockModeNone.
+	LockMode LockMode `yaml:"lock_mode"`
+	// LockTimeout bounds how long New retries acquiring the lock before
+	// giving up and returning ErrPositionsLocked. A zero value means a
+	// single, immediate attempt.
+	LockTimeout time.Duration `yaml:"lock_timeout"`
+}
+
+// Positions tracks the position (offset) of files being tailed so that
+// tailing can resume across restarts.
+type Positions interface {
+	// Get returns how far we've tailed a position for the given file on disk.
+	Get(path string) (int64, error)
+	// Put records how far we've tailed a position for the given file on disk.
+	Put(path string, pos int64)
+	// Remove removes the position tracking for a filepath.
+	Remove(path string)
+	// Stop the Positions.
+	Stop()
+}
+
+type positionFile struct {
+	cfg      Config
+	mtx      sync.Mutex
+	position map[string]int64
+	logger   log.Logger
+	quit     chan struct{}
+	done     chan struct{}
+
+	lockFile *os.File
+}
+
+type positionEntry struct {
+	Path   string `yaml:"path"`
+	Offset int64  `yaml:"offset"`
+}
+
+type positionFileContent struct {
+	Positions []positionEntry `yaml:"positions"`
+}
+
+// New creates a new Positions tracker backed by a yaml file on disk, flushed
+// every cfg.SyncPeriod. If cfg.LockMode is not LockModeNone, New first takes
+// an advisory lock on cfg.PositionsFile, retrying for up to cfg.LockTimeout
+// before giving up with ErrPositionsLocked.
+func New(logger log.Logger, cfg Config) (Positions, error) {
+	lockFile, err := acquireLock(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	positions, err := readPositionsFile(cfg)
+	if err != nil {
+		if lockFile != nil {
+			_ = unlockFile(lockFile)
+			_ = lockFile.Close()
+		}
+		return nil, err
+	}
+
+	p := &positionFile{
+		cfg:      cfg,
+		position: positions,
+		logger:   logger,
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+		lockFile: lockFile,
+	}
+
+	go p.run()
+	return p, nil
+}
+
+// acquireLock takes the lock implied by cfg.LockMode on cfg.PositionsFile,
+// polling until it succeeds or cfg.LockTimeout elapses. It returns a nil
+// file (and nil error) when LockMode is LockModeNone.
+func acquireLock(cfg Config) (*os.File, error) {
+	if cfg.LockMode == "" || cfg.LockMode == LockModeNone {
+		return nil, nil
+	}
+
+	f, err := os.OpenFile(cfg.PositionsFile, os.O_CREATE|os.O_RDWR, 0640)
+	if err != nil {
+		return nil, err
+	}
+
+	shared := cfg.LockMode == LockModeSharedReadOnly
+
+	deadline := time.Now().Add(cfg.LockTimeout)
+	for {
+		acquired, err := tryLockFile(f, shared)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		if acquired {
+			return f, nil
+		}
+		if time.Now().After(deadline) {
+			_ = f.Close()
+			return nil, ErrPositionsLocked
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func (p *positionFile) Get(path string) (int64, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.position[path], nil
+}
+
+func (p *positionFile) Put(path string, pos int64) {
+	if p.cfg.ReadOnly {
+		return
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.position[path] = pos
+}
+
+func (p *positionFile) Remove(path string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	delete(p.position, path)
+}
+
+func (p *positionFile) Stop() {
+	close(p.quit)
+	<-p.done
+
+	if p.lockFile != nil {
+		_ = unlockFile(p.lockFile)
+		_ = p.lockFile.Close()
+	}
+}
+
+func (p *positionFile) run() {
+	defer func() {
+		p.save()
+		close(p.done)
+	}()
+
+	ticker := time.NewTicker(p.cfg.SyncPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.save()
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+func (p *positionFile) save() {
+	if p.cfg.ReadOnly {
+		return
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if err := writePositionFile(p.cfg.PositionsFile, p.position); err != nil {
+		level.Error(p.logger).Log("msg", "error writing positions file", "error", err)
+	}
+}
+
+func readPositionsFile(cfg Config) (map[string]int64, error) {
+	f, err := os.Open(cfg.PositionsFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]int64{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var content positionFileContent
+	buf, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(buf, &content); err != nil {
+		if cfg.IgnoreInvalidYaml {
+			return map[string]int64{}, nil
+		}
+		return nil, err
+	}
+
+	positions := map[string]int64{}
+	for _, entry := range content.Positions {
+		positions[entry.Path] = entry.Offset
+	}
+	return positions, nil
+}
+
+func writePositionFile(path string, positions map[string]int64) error {
+	content := positionFileContent{}
+	for p, offset := range positions {
+		content.Positions = append(content.Positions, positionEntry{Path: p, Offset: offset})
+	}
+
+	buf, err := yaml.Marshal(content)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filepath.Clean(path))
+}
@@ -0,0 +1,57 @@
+package positions
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPositions_SecondExclusiveLockFails(t *testing.T) {
+	w := log.NewSyncWriter(os.Stderr)
+	logger := log.NewLogfmtLogger(w)
+
+	tempDir := t.TempDir()
+	positionsFileName := filepath.Join(tempDir, "positions.yml")
+
+	first, err := New(logger, Config{
+		SyncPeriod:    10 * time.Millisecond,
+		PositionsFile: positionsFileName,
+		LockMode:      LockModeExclusive,
+	})
+	require.NoError(t, err)
+	defer first.Stop()
+
+	_, err = New(logger, Config{
+		SyncPeriod:    10 * time.Millisecond,
+		PositionsFile: positionsFileName,
+		LockMode:      LockModeExclusive,
+		LockTimeout:   50 * time.Millisecond,
+	})
+	require.ErrorIs(t, err, ErrPositionsLocked)
+}
+
+func TestPositions_NoLockModeAllowsConcurrentInstances(t *testing.T) {
+	w := log.NewSyncWriter(os.Stderr)
+	logger := log.NewLogfmtLogger(w)
+
+	tempDir := t.TempDir()
+	positionsFileName := filepath.Join(tempDir, "positions.yml")
+
+	first, err := New(logger, Config{
+		SyncPeriod:    10 * time.Millisecond,
+		PositionsFile: positionsFileName,
+	})
+	require.NoError(t, err)
+	defer first.Stop()
+
+	second, err := New(logger, Config{
+		SyncPeriod:    10 * time.Millisecond,
+		PositionsFile: positionsFileName,
+	})
+	require.NoError(t, err)
+	defer second.Stop()
+}
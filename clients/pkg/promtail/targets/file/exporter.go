@@ -0,0 +1,333 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// PushFormat selects the wire format used when pushing metrics to a
+// PushTarget.
+type PushFormat string
+
+const (
+	// PushFormatRemoteWrite sends samples using the Prometheus remote-write
+	// protocol.
+	PushFormatRemoteWrite PushFormat = "remote-write"
+	// PushFormatInfluxLineProtocol sends samples using InfluxDB line
+	// protocol, for targets that don't speak remote-write.
+	PushFormatInfluxLineProtocol PushFormat = "influx"
+)
+
+// MetricSample is a single point-in-time value of one of the Metrics
+// counters/gauges, as read by an Exporter between push intervals.
+type MetricSample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// MetricsSource is implemented by Metrics to let an Exporter read a
+// point-in-time snapshot of the counters/gauges it cares about without
+// depending on a pull-based prometheus.Registry.
+type MetricsSource interface {
+	Snapshot() []MetricSample
+}
+
+type pushTarget struct {
+	url    string
+	format PushFormat
+}
+
+// ExporterOption configures an Exporter created with New.
+type ExporterOption func(*exporterOptions)
+
+type exporterOptions struct {
+	pushInterval  time.Duration
+	hostname      string
+	omitProgLabel bool
+	emitTimestamp bool
+	disabled      bool
+	pushTargets   []pushTarget
+}
+
+// PushInterval sets how often metrics are pushed. Defaults to 15s.
+func PushInterval(d time.Duration) ExporterOption {
+	return func(o *exporterOptions) { o.pushInterval = d }
+}
+
+// Hostname sets the value of the "instance" identity label attached to every
+// pushed sample. Defaults to os.Hostname().
+func Hostname(h string) ExporterOption {
+	return func(o *exporterOptions) { o.hostname = h }
+}
+
+// OmitProgLabel drops the "prog"="promtail" label that is otherwise attached
+// to every pushed sample.
+func OmitProgLabel(omit bool) ExporterOption {
+	return func(o *exporterOptions) { o.omitProgLabel = omit }
+}
+
+// EmitTimestamp controls whether pushed InfluxDB line-protocol samples carry
+// the collection timestamp or let the remote target stamp them on arrival.
+// Remote-write samples always carry the collection timestamp, since that
+// protocol has no way to leave it out.
+func EmitTimestamp(emit bool) ExporterOption {
+	return func(o *exporterOptions) { o.emitTimestamp = emit }
+}
+
+// DisableExport turns the Exporter into a no-op; useful for wiring it in
+// unconditionally and gating it from config.
+func DisableExport() ExporterOption {
+	return func(o *exporterOptions) { o.disabled = true }
+}
+
+// PushTarget adds a remote endpoint metrics are pushed to, in the given
+// format. May be called more than once to push to several targets.
+func PushTarget(url string, format PushFormat) ExporterOption {
+	return func(o *exporterOptions) {
+		o.pushTargets = append(o.pushTargets, pushTarget{url: url, format: format})
+	}
+}
+
+// PushTargetConfig is the yaml-facing form of a PushTarget.
+type PushTargetConfig struct {
+	URL    string     `yaml:"url"`
+	Format PushFormat `yaml:"format"`
+}
+
+// ExporterConfig configures the push-mode exporter for a FileTarget's
+// Config. A nil ExporterConfig (the zero value of the pointer in Config)
+// means no exporter is created.
+type ExporterConfig struct {
+	PushInterval  time.Duration      `yaml:"push_interval"`
+	Hostname      string             `yaml:"hostname"`
+	OmitProgLabel bool               `yaml:"omit_prog_label"`
+	EmitTimestamp bool               `yaml:"emit_timestamp"`
+	Disabled      bool               `yaml:"disabled"`
+	PushTargets   []PushTargetConfig `yaml:"push_targets"`
+}
+
+// options converts the config into the ExporterOptions New expects.
+func (c *ExporterConfig) options() []ExporterOption {
+	opts := []ExporterOption{
+		EmitTimestamp(c.EmitTimestamp),
+		OmitProgLabel(c.OmitProgLabel),
+	}
+	if c.PushInterval > 0 {
+		opts = append(opts, PushInterval(c.PushInterval))
+	}
+	if c.Hostname != "" {
+		opts = append(opts, Hostname(c.Hostname))
+	}
+	if c.Disabled {
+		opts = append(opts, DisableExport())
+	}
+	for _, pt := range c.PushTargets {
+		opts = append(opts, PushTarget(pt.URL, pt.Format))
+	}
+	return opts
+}
+
+// Exporter periodically pushes a MetricsSource's samples to one or more
+// remote targets. It exists alongside the pull-based prometheus.Registry
+// path for sidecar/short-lived promtail deployments where a scrape before
+// shutdown can't be relied upon.
+type Exporter struct {
+	logger log.Logger
+	store  MetricsSource
+	opts   exporterOptions
+	client *http.Client
+
+	cancel context.CancelFunc
+
+	// initDone is closed once the Exporter's first push attempt (if any)
+	// has run, so callers can observe it started cleanly.
+	initDone chan struct{}
+	// shutdownDone is closed once the push loop has exited and performed
+	// its final push, mirroring the done/posdone pattern used by tailer.
+	shutdownDone chan struct{}
+}
+
+// New creates an Exporter that pushes store's samples on opts.pushInterval
+// until ctx is cancelled or Stop is called. New always returns a non-nil
+// Exporter; pass DisableExport() to make it push nothing.
+func New(ctx context.Context, logger log.Logger, store MetricsSource, options ...ExporterOption) *Exporter {
+	opts := exporterOptions{
+		pushInterval:  15 * time.Second,
+		emitTimestamp: true,
+	}
+	for _, opt := range options {
+		opt(&opts)
+	}
+	if opts.hostname == "" {
+		if h, err := os.Hostname(); err == nil {
+			opts.hostname = h
+		}
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	e := &Exporter{
+		logger:       logger,
+		store:        store,
+		opts:         opts,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		cancel:       cancel,
+		initDone:     make(chan struct{}),
+		shutdownDone: make(chan struct{}),
+	}
+
+	go e.run(runCtx)
+
+	return e
+}
+
+func (e *Exporter) run(ctx context.Context) {
+	defer close(e.shutdownDone)
+
+	if e.opts.disabled || len(e.opts.pushTargets) == 0 {
+		close(e.initDone)
+		<-ctx.Done()
+		return
+	}
+
+	ticker := time.NewTicker(e.opts.pushInterval)
+	defer ticker.Stop()
+
+	e.push()
+	close(e.initDone)
+
+	for {
+		select {
+		case <-ticker.C:
+			e.push()
+		case <-ctx.Done():
+			// Flush a final time so a target that only scrapes before
+			// shutdown still sees the last values.
+			e.push()
+			return
+		}
+	}
+}
+
+func (e *Exporter) push() {
+	if e.opts.disabled || len(e.opts.pushTargets) == 0 {
+		return
+	}
+
+	samples := e.store.Snapshot()
+	now := time.Now()
+
+	for _, t := range e.opts.pushTargets {
+		body, contentType, err := e.encode(t.format, samples, now)
+		if err != nil {
+			level.Error(e.logger).Log("msg", "failed to encode metrics for push", "target", t.url, "format", t.format, "error", err)
+			continue
+		}
+		if err := e.send(t.url, contentType, body); err != nil {
+			level.Error(e.logger).Log("msg", "failed to push metrics", "target", t.url, "error", err)
+		}
+	}
+}
+
+func (e *Exporter) encode(format PushFormat, samples []MetricSample, now time.Time) ([]byte, string, error) {
+	switch format {
+	case PushFormatInfluxLineProtocol:
+		return e.encodeInflux(samples, now), "text/plain; version=0.0.4", nil
+	case PushFormatRemoteWrite:
+		body, err := e.encodeRemoteWrite(samples, now)
+		if err != nil {
+			return nil, "", err
+		}
+		return body, "application/x-protobuf", nil
+	default:
+		return nil, "", fmt.Errorf("unsupported push format: %s", format)
+	}
+}
+
+// encodeInflux renders samples as InfluxDB line protocol.
+func (e *Exporter) encodeInflux(samples []MetricSample, now time.Time) []byte {
+	var buf bytes.Buffer
+	for _, s := range samples {
+		buf.WriteString(s.Name)
+		buf.WriteString(",instance=")
+		buf.WriteString(e.opts.hostname)
+		if !e.opts.omitProgLabel {
+			buf.WriteString(",prog=promtail")
+		}
+		for k, v := range s.Labels {
+			fmt.Fprintf(&buf, ",%s=%s", k, v)
+		}
+		fmt.Fprintf(&buf, " value=%g", s.Value)
+		if e.opts.emitTimestamp {
+			fmt.Fprintf(&buf, " %d", now.UnixNano())
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// encodeRemoteWrite renders samples as a snappy-compressed
+// prompb.WriteRequest, the wire format Prometheus remote-write receivers
+// actually expect.
+func (e *Exporter) encodeRemoteWrite(samples []MetricSample, now time.Time) ([]byte, error) {
+	series := make([]prompb.TimeSeries, 0, len(samples))
+	for _, s := range samples {
+		labels := make([]prompb.Label, 0, len(s.Labels)+2)
+		labels = append(labels, prompb.Label{Name: "__name__", Value: s.Name})
+		labels = append(labels, prompb.Label{Name: "instance", Value: e.opts.hostname})
+		if !e.opts.omitProgLabel {
+			labels = append(labels, prompb.Label{Name: "prog", Value: "promtail"})
+		}
+		for k, v := range s.Labels {
+			labels = append(labels, prompb.Label{Name: k, Value: v})
+		}
+
+		ts := now.UnixNano() / int64(time.Millisecond)
+
+		series = append(series, prompb.TimeSeries{
+			Labels:  labels,
+			Samples: []prompb.Sample{{Value: s.Value, Timestamp: ts}},
+		})
+	}
+
+	data, err := (&prompb.WriteRequest{Timeseries: series}).Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("marshal remote-write request: %w", err)
+	}
+
+	return snappy.Encode(nil, data), nil
+}
+
+func (e *Exporter) send(url, contentType string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("push target returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Stop cancels the push loop and blocks until its final push has completed.
+func (e *Exporter) Stop() {
+	e.cancel()
+	<-e.shutdownDone
+}
@@ -0,0 +1,296 @@
+package file
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/clients/pkg/promtail/client/fake"
+	"github.com/grafana/loki/clients/pkg/promtail/positions"
+)
+
+func TestExporter_PushesOnInterval(t *testing.T) {
+	pushes := make(chan []byte, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := io.ReadAll(r.Body)
+		pushes <- buf
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	metrics := NewMetrics(prometheus.NewRegistry())
+	metrics.filesActive.Set(3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e := New(ctx, log.NewNopLogger(), metrics,
+		PushInterval(10*time.Millisecond),
+		Hostname("test-host"),
+		PushTarget(srv.URL, PushFormatInfluxLineProtocol),
+	)
+	defer e.Stop()
+
+	select {
+	case body := <-pushes:
+		require.Contains(t, string(body), "promtail_files_active_total")
+		require.Contains(t, string(body), "instance=test-host")
+	case <-time.After(time.Second):
+		t.Fatal("expected at least one push within 1s")
+	}
+
+	// The first push happens at startup; a second one shows the interval
+	// ticker is pushing too.
+	select {
+	case <-pushes:
+	case <-time.After(time.Second):
+		t.Fatal("expected a second push on the 10ms interval within 1s")
+	}
+}
+
+func TestExporter_RemoteWriteIsValidWriteRequest(t *testing.T) {
+	pushes := make(chan []byte, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := io.ReadAll(r.Body)
+		pushes <- buf
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	metrics := NewMetrics(prometheus.NewRegistry())
+	metrics.filesActive.Set(3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e := New(ctx, log.NewNopLogger(), metrics,
+		PushInterval(10*time.Millisecond),
+		Hostname("test-host"),
+		PushTarget(srv.URL, PushFormatRemoteWrite),
+	)
+	defer e.Stop()
+
+	select {
+	case body := <-pushes:
+		raw, err := snappy.Decode(nil, body)
+		require.NoError(t, err)
+
+		var wr prompb.WriteRequest
+		require.NoError(t, wr.Unmarshal(raw))
+		require.NotEmpty(t, wr.Timeseries)
+
+		var sawFilesActive bool
+		for _, ts := range wr.Timeseries {
+			for _, l := range ts.Labels {
+				if l.Name == "__name__" && l.Value == "promtail_files_active_total" {
+					sawFilesActive = true
+				}
+			}
+		}
+		require.True(t, sawFilesActive, "expected promtail_files_active_total series in the write request")
+	case <-time.After(time.Second):
+		t.Fatal("expected at least one push within 1s")
+	}
+}
+
+// TestFileTarget_ExporterFlushesOnStop is the integration point the request
+// asked for: a FileTarget configured with Config.Exporter pushes a final set
+// of samples when Stop returns, without the caller having to scrape first.
+func TestFileTarget_ExporterFlushesOnStop(t *testing.T) {
+	logger := log.NewNopLogger()
+
+	pushes := make(chan struct{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushes <- struct{}{}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	tempDir := t.TempDir()
+	positionsFileName := filepath.Join(tempDir, "positions.yml")
+	logFile := filepath.Join(tempDir, "test1.log")
+
+	ps, err := positions.New(logger, positions.Config{
+		SyncPeriod:    10 * time.Millisecond,
+		PositionsFile: positionsFileName,
+	})
+	require.NoError(t, err)
+	defer ps.Stop()
+
+	client := fake.New(func() {})
+	defer client.Stop()
+
+	target, err := NewFileTarget(NewMetrics(prometheus.NewRegistry()), logger, client, ps, filepath.Join(tempDir, "*.log"), "", nil, nil, &Config{
+		SyncPeriod: 10 * time.Millisecond,
+		Exporter: &ExporterConfig{
+			PushInterval: time.Hour, // only the Stop()-triggered flush should fire within the test
+			PushTargets:  []PushTargetConfig{{URL: srv.URL, Format: PushFormatInfluxLineProtocol}},
+		},
+	}, DefaultWatchConig, nil, nil, "", nil)
+	require.NoError(t, err)
+
+	_, err = os.Create(logFile)
+	require.NoError(t, err)
+
+	// Drain the initial push triggered when the exporter starts.
+	select {
+	case <-pushes:
+	case <-time.After(time.Second):
+		t.Fatal("expected the exporter's initial push")
+	}
+
+	target.Stop()
+
+	select {
+	case <-pushes:
+	default:
+		t.Fatal("expected Stop to trigger a final exporter push")
+	}
+}
+
+// TestFileTarget_ExportersAreIndependentPerTarget guards against the
+// exporter's lifecycle being wired to the shared *Metrics instead of to the
+// FileTarget that configured it: a promtail process runs one Metrics shared
+// across every discovered target, so if Stop or construction touched
+// metrics.exporter, one target's Config.Exporter would clobber another's, and
+// stopping one target would kill an unrelated target's exporter too.
+func TestFileTarget_ExportersAreIndependentPerTarget(t *testing.T) {
+	logger := log.NewNopLogger()
+
+	pushesA := make(chan struct{}, 10)
+	srvA := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushesA <- struct{}{}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srvA.Close()
+
+	pushesB := make(chan struct{}, 10)
+	srvB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushesB <- struct{}{}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srvB.Close()
+
+	sharedMetrics := NewMetrics(prometheus.NewRegistry())
+
+	tempDirA := t.TempDir()
+	psA, err := positions.New(logger, positions.Config{
+		SyncPeriod:    10 * time.Millisecond,
+		PositionsFile: filepath.Join(tempDirA, "positions.yml"),
+	})
+	require.NoError(t, err)
+	defer psA.Stop()
+
+	clientA := fake.New(func() {})
+	defer clientA.Stop()
+
+	targetA, err := NewFileTarget(sharedMetrics, logger, clientA, psA, filepath.Join(tempDirA, "*.log"), "", nil, nil, &Config{
+		SyncPeriod: 10 * time.Millisecond,
+		Exporter: &ExporterConfig{
+			PushInterval: time.Hour,
+			PushTargets:  []PushTargetConfig{{URL: srvA.URL, Format: PushFormatInfluxLineProtocol}},
+		},
+	}, DefaultWatchConig, nil, nil, "", nil)
+	require.NoError(t, err)
+
+	// Draining targetA's startup push.
+	select {
+	case <-pushesA:
+	case <-time.After(time.Second):
+		t.Fatal("expected targetA's initial push")
+	}
+
+	tempDirB := t.TempDir()
+	psB, err := positions.New(logger, positions.Config{
+		SyncPeriod:    10 * time.Millisecond,
+		PositionsFile: filepath.Join(tempDirB, "positions.yml"),
+	})
+	require.NoError(t, err)
+	defer psB.Stop()
+
+	clientB := fake.New(func() {})
+	defer clientB.Stop()
+
+	// Constructing a second target against the same shared Metrics must not
+	// clobber targetA's exporter reference.
+	targetB, err := NewFileTarget(sharedMetrics, logger, clientB, psB, filepath.Join(tempDirB, "*.log"), "", nil, nil, &Config{
+		SyncPeriod: 10 * time.Millisecond,
+		Exporter: &ExporterConfig{
+			PushInterval: time.Hour,
+			PushTargets:  []PushTargetConfig{{URL: srvB.URL, Format: PushFormatInfluxLineProtocol}},
+		},
+	}, DefaultWatchConig, nil, nil, "", nil)
+	require.NoError(t, err)
+	defer targetB.Stop()
+
+	select {
+	case <-pushesB:
+	case <-time.After(time.Second):
+		t.Fatal("expected targetB's initial push")
+	}
+
+	// Stopping targetA must flush only targetA's exporter, not targetB's.
+	targetA.Stop()
+
+	select {
+	case <-pushesA:
+	default:
+		t.Fatal("expected targetA.Stop to trigger targetA's own final push")
+	}
+	select {
+	case <-pushesB:
+		t.Fatal("targetA.Stop must not trigger targetB's exporter")
+	default:
+	}
+}
+
+func TestExporter_DisabledIsNoop(t *testing.T) {
+	metrics := NewMetrics(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e := New(ctx, log.NewNopLogger(), metrics, DisableExport())
+	e.Stop()
+}
+
+func TestExporter_StopFlushesFinalPush(t *testing.T) {
+	pushes := make(chan struct{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushes <- struct{}{}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	metrics := NewMetrics(prometheus.NewRegistry())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e := New(ctx, log.NewNopLogger(), metrics,
+		PushInterval(time.Hour),
+		PushTarget(srv.URL, PushFormatInfluxLineProtocol),
+	)
+
+	// Drain the initial push triggered by New.
+	<-pushes
+
+	e.Stop()
+
+	select {
+	case <-pushes:
+	default:
+		t.Fatal("expected a final push on Stop")
+	}
+}
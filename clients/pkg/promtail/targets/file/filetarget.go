@@ -0,0 +1,475 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/model"
+
+	"github.com/grafana/loki/clients/pkg/promtail/api"
+	"github.com/grafana/loki/clients/pkg/promtail/positions"
+)
+
+// Config describes behavior for a single target.
+type Config struct {
+	SyncPeriod time.Duration `yaml:"sync_period"`
+
+	// Exporter, when set, pushes this target's metrics to one or more
+	// remote targets on an interval, in addition to (or instead of) a
+	// pull-based prometheus.Registry scrape. Nil disables it.
+	Exporter *ExporterConfig `yaml:"metrics_exporter,omitempty"`
+}
+
+// WatcherMode selects how a FileTarget is notified of directory changes.
+type WatcherMode string
+
+const (
+	// WatcherModeAuto picks fsnotify where it is known to be reliable and
+	// falls back to polling on filesystems (NFS, CIFS, FUSE, overlayfs) where
+	// inotify/kqueue events are known to be dropped or never delivered.
+	WatcherModeAuto WatcherMode = "auto"
+	// WatcherModeFSNotify uses fsnotify, falling back to polling only for a
+	// directory whose fsnotify watch cannot be added.
+	WatcherModeFSNotify WatcherMode = "fsnotify"
+	// WatcherModePoll always uses directory polling.
+	WatcherModePoll WatcherMode = "poll"
+)
+
+// WatchConfig controls how a FileTarget watches directories for new, removed
+// and renamed files.
+type WatchConfig struct {
+	// MinPollFrequency and MaxPollFrequency are not read by FileTarget: the
+	// fsnotify watcher is created once, with no retry or backoff.
+	MinPollFrequency time.Duration
+	MaxPollFrequency time.Duration
+
+	// WatcherMode selects fsnotify, polling, or automatic detection between
+	// the two based on the filesystem backing each watched directory.
+	WatcherMode WatcherMode
+	// PollingInterval is how often a directory is re-listed when polling is
+	// in effect, including a directory that falls back to polling because
+	// its fsnotify watch could not be added.
+	PollingInterval time.Duration
+}
+
+// DefaultWatchConig is the default watch behaviour used when none is given:
+// fsnotify with automatic fallback to polling every 10s.
+var DefaultWatchConig = WatchConfig{
+	MinPollFrequency: 250 * time.Millisecond,
+	MaxPollFrequency: 250 * time.Millisecond,
+	WatcherMode:      WatcherModeAuto,
+	PollingInterval:  10 * time.Second,
+}
+
+type fileTargetEventType int
+
+const (
+	fileTargetEventWatchStart fileTargetEventType = iota
+	fileTargetEventWatchStop
+)
+
+// fileTargetEvent is emitted onto a FileTarget's targetEventHandler channel
+// (when set) whenever a directory starts or stops being watched. Tests use
+// this to assert on watch lifecycle without reaching into private state.
+// Once Stop has been called, an event may be dropped instead of delivered.
+type fileTargetEvent struct {
+	path      string
+	eventType fileTargetEventType
+}
+
+// FileTarget tails files matching a glob path, creating and tearing down
+// tailers as matching files come and go.
+type FileTarget struct {
+	metrics   *Metrics
+	logger    log.Logger
+	handler   api.EntryHandler
+	positions positions.Positions
+
+	path             string
+	pathExclude      string
+	labels           model.LabelSet
+	discoveredLabels model.LabelSet
+
+	targetConfig *Config
+	watchConfig  WatchConfig
+
+	encoding      string
+	decompressCfg *DecompressionConfig
+
+	watcher            *fsnotify.Watcher
+	fileEventWatcher   chan fsnotify.Event
+	targetEventHandler chan fileTargetEvent
+
+	watches     map[string]struct{}
+	watchersMtx sync.Mutex
+	pollers     map[string]*dirPoller
+
+	readersMtx sync.Mutex
+	readers    map[string]Reader
+
+	// exporter is owned by this FileTarget alone (unlike metrics, which is
+	// shared across every FileTarget in the process), since targetConfig.Exporter
+	// is per-target config: sharing it off metrics let one target's Stop kill
+	// another target's exporter, and let concurrent targets clobber each
+	// other's *Exporter reference and leak the loser's goroutine.
+	exporter *Exporter
+
+	done chan struct{}
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// DecompressionConfig describes how to handle compressed log files.
+// (placeholder, wired up by a future request)
+type DecompressionConfig struct {
+	Enabled bool
+	Format  string
+}
+
+// NewFileTarget creates a new FileTarget that tails files matching path
+// (excluding pathExclude) and forwards entries to handler.
+func NewFileTarget(
+	metrics *Metrics,
+	logger log.Logger,
+	handler api.EntryHandler,
+	positions positions.Positions,
+	path string,
+	pathExclude string,
+	labels model.LabelSet,
+	discoveredLabels model.LabelSet,
+	targetConfig *Config,
+	watchConfig WatchConfig,
+	fileEventWatcher chan fsnotify.Event,
+	targetEventHandler chan fileTargetEvent,
+	encoding string,
+	decompressCfg *DecompressionConfig,
+) (*FileTarget, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("creating fsnotify watcher: %w", err)
+	}
+
+	t := &FileTarget{
+		metrics:            metrics,
+		logger:             logger,
+		handler:            handler,
+		positions:          positions,
+		path:               path,
+		pathExclude:        pathExclude,
+		labels:             labels,
+		discoveredLabels:   discoveredLabels,
+		targetConfig:       targetConfig,
+		watchConfig:        watchConfig,
+		encoding:           encoding,
+		decompressCfg:      decompressCfg,
+		watcher:            watcher,
+		fileEventWatcher:   fileEventWatcher,
+		targetEventHandler: targetEventHandler,
+		watches:            map[string]struct{}{},
+		pollers:            map[string]*dirPoller{},
+		readers:            map[string]Reader{},
+		done:               make(chan struct{}),
+		quit:               make(chan struct{}),
+	}
+
+	if err := t.sync(); err != nil {
+		return nil, fmt.Errorf("initial sync of targets failed: %w", err)
+	}
+
+	if targetConfig.Exporter != nil {
+		t.exporter = New(context.Background(), logger, metrics, targetConfig.Exporter.options()...)
+	}
+
+	t.wg.Add(1)
+	go t.run()
+
+	return t, nil
+}
+
+// Stop shuts down the target, stopping all tailers and directory watches. If
+// targetConfig.Exporter was set, it also stops this target's own exporter,
+// which performs one last push before returning so a scrape-before-shutdown
+// isn't required to see final values.
+func (t *FileTarget) Stop() {
+	close(t.quit)
+	t.wg.Wait()
+	<-t.done
+	if t.exporter != nil {
+		t.exporter.Stop()
+	}
+}
+
+func (t *FileTarget) run() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(t.targetConfig.SyncPeriod)
+	defer func() {
+		ticker.Stop()
+		t.stopWatching()
+		t.readersMtx.Lock()
+		for p := range t.readers {
+			t.stopTailingLocked(p)
+		}
+		t.readersMtx.Unlock()
+		close(t.done)
+	}()
+
+	for {
+		select {
+		case event, ok := <-t.fileEventWatcherChan():
+			if !ok {
+				continue
+			}
+			t.handleFileEvent(event)
+		case <-ticker.C:
+			if err := t.sync(); err != nil {
+				level.Error(t.logger).Log("msg", "error running sync function", "error", err)
+			}
+		case <-t.quit:
+			return
+		}
+	}
+}
+
+// fileEventWatcherChan returns the channel to receive fsnotify events from:
+// either the injected test channel, or the real watcher's Events channel.
+func (t *FileTarget) fileEventWatcherChan() chan fsnotify.Event {
+	if t.fileEventWatcher != nil {
+		return t.fileEventWatcher
+	}
+	return t.watcher.Events
+}
+
+func (t *FileTarget) handleFileEvent(event fsnotify.Event) {
+	switch {
+	case event.Op&fsnotify.Create == fsnotify.Create:
+		matched, err := t.matches(event.Name)
+		if err != nil {
+			level.Error(t.logger).Log("msg", "failed to match file", "file", event.Name, "error", err)
+			return
+		}
+		if !matched {
+			return
+		}
+		t.startTailing([]string{event.Name})
+	case event.Op&fsnotify.Remove == fsnotify.Remove, event.Op&fsnotify.Rename == fsnotify.Rename:
+		t.stopTailing([]string{event.Name})
+	}
+}
+
+func (t *FileTarget) matches(path string) (bool, error) {
+	matched, err := doublestar.Match(t.path, path)
+	if err != nil {
+		return false, err
+	}
+	if !matched {
+		return false, nil
+	}
+	if t.pathExclude == "" {
+		return true, nil
+	}
+	excluded, err := doublestar.Match(t.pathExclude, path)
+	if err != nil {
+		return false, err
+	}
+	return !excluded, nil
+}
+
+// sync reconciles the set of watched directories and tailed files against
+// what currently matches t.path/t.pathExclude on disk.
+func (t *FileTarget) sync() error {
+	matches, err := doublestar.FilepathGlob(t.path)
+	if err != nil {
+		return fmt.Errorf("glob failed: %w", err)
+	}
+
+	toTail := make([]string, 0, len(matches))
+	dirs := map[string]struct{}{}
+	for _, m := range matches {
+		if t.pathExclude != "" {
+			excluded, err := doublestar.Match(t.pathExclude, m)
+			if err != nil {
+				return err
+			}
+			if excluded {
+				continue
+			}
+		}
+		toTail = append(toTail, m)
+		dirs[dirOf(m)] = struct{}{}
+	}
+
+	t.syncWatches(dirs)
+
+	t.readersMtx.Lock()
+	defer t.readersMtx.Unlock()
+
+	toStop := toStopTailing(toTail, t.readers)
+	for _, p := range toStop {
+		t.stopTailingLocked(p)
+	}
+
+	for _, p := range toTail {
+		t.startTailingLocked(p)
+	}
+
+	return nil
+}
+
+func (t *FileTarget) startTailing(paths []string) {
+	t.readersMtx.Lock()
+	defer t.readersMtx.Unlock()
+
+	for _, p := range paths {
+		t.startTailingLocked(p)
+	}
+}
+
+// startTailingLocked starts a tailer for path unless one is already running.
+// A reader whose tail routine has died (e.g. the tomb was killed because the
+// underlying file became unreadable) is stopped and replaced rather than
+// left in place, so a single stuck tailer can't permanently block re-tailing
+// a path. Callers must hold readersMtx.
+func (t *FileTarget) startTailingLocked(path string) {
+	if reader, ok := t.readers[path]; ok {
+		if reader.IsRunning() {
+			return
+		}
+		t.stopTailingLocked(path)
+	}
+
+	tailer, err := newTailer(t.metrics, t.logger, t.handler, t.positions, path, t.encoding)
+	if err != nil {
+		level.Error(t.logger).Log("msg", "failed to start tailer", "path", path, "error", err)
+		return
+	}
+	t.readers[path] = tailer
+	t.metrics.filesActive.Inc()
+}
+
+func (t *FileTarget) stopTailing(paths []string) {
+	t.readersMtx.Lock()
+	defer t.readersMtx.Unlock()
+	for _, p := range paths {
+		t.stopTailingLocked(p)
+	}
+}
+
+func (t *FileTarget) stopTailingLocked(path string) {
+	reader, ok := t.readers[path]
+	if !ok {
+		return
+	}
+	reader.Stop()
+	delete(t.readers, path)
+	t.metrics.filesActive.Dec()
+}
+
+// syncWatches reconciles the set of directories being watched (either via
+// fsnotify or, depending on watchConfig.WatcherMode, via polling) against
+// wantDirs.
+func (t *FileTarget) syncWatches(wantDirs map[string]struct{}) {
+	t.watchersMtx.Lock()
+	defer t.watchersMtx.Unlock()
+
+	for dir := range wantDirs {
+		if _, ok := t.watches[dir]; ok {
+			continue
+		}
+		t.startWatching(dir)
+	}
+
+	for dir := range t.watches {
+		if _, ok := wantDirs[dir]; ok {
+			continue
+		}
+		t.stopWatchingDir(dir)
+	}
+}
+
+func (t *FileTarget) startWatching(dir string) {
+	mode := t.watcherModeFor(dir)
+
+	switch mode {
+	case WatcherModePoll:
+		poller := newDirPoller(t.logger, dir, t.watchConfig.PollingInterval, t.fileEventWatcherChan())
+		t.pollers[dir] = poller
+		poller.Start()
+	default:
+		if err := t.watcher.Add(dir); err != nil {
+			level.Error(t.logger).Log("msg", "failed to add directory watch, falling back to polling", "dir", dir, "error", err)
+			poller := newDirPoller(t.logger, dir, t.watchConfig.PollingInterval, t.fileEventWatcherChan())
+			t.pollers[dir] = poller
+			poller.Start()
+			mode = WatcherModePoll
+		}
+	}
+
+	t.watches[dir] = struct{}{}
+	watcherModeGauge.WithLabelValues(dir).Set(watcherModeValue(mode))
+	t.sendEvent(dir, fileTargetEventWatchStart)
+}
+
+func (t *FileTarget) stopWatchingDir(dir string) {
+	if poller, ok := t.pollers[dir]; ok {
+		poller.Stop()
+		delete(t.pollers, dir)
+	} else {
+		_ = t.watcher.Remove(dir)
+	}
+	delete(t.watches, dir)
+	watcherModeGauge.DeleteLabelValues(dir)
+	t.sendEvent(dir, fileTargetEventWatchStop)
+}
+
+func (t *FileTarget) stopWatching() {
+	t.watchersMtx.Lock()
+	defer t.watchersMtx.Unlock()
+	for dir := range t.watches {
+		t.stopWatchingDir(dir)
+	}
+	_ = t.watcher.Close()
+}
+
+func (t *FileTarget) sendEvent(dir string, eventType fileTargetEventType) {
+	if t.targetEventHandler == nil {
+		return
+	}
+	select {
+	case t.targetEventHandler <- fileTargetEvent{path: dir, eventType: eventType}:
+	case <-t.quit:
+	}
+}
+
+// watcherModeFor resolves WatcherModeAuto to a concrete mode for dir by
+// inspecting the filesystem type backing it (NFS/CIFS/FUSE/overlayfs are
+// known to drop or never deliver inotify/kqueue events).
+func (t *FileTarget) watcherModeFor(dir string) WatcherMode {
+	switch t.watchConfig.WatcherMode {
+	case WatcherModeFSNotify, WatcherModePoll:
+		return t.watchConfig.WatcherMode
+	default:
+		if isUnreliableNotifyFilesystem(dir) {
+			return WatcherModePoll
+		}
+		return WatcherModeFSNotify
+	}
+}
+
+func dirOf(path string) string {
+	dir := path
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i] == os.PathSeparator {
+			dir = path[:i]
+			break
+		}
+	}
+	return dir
+}
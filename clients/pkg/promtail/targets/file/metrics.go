@@ -0,0 +1,125 @@
+package file
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Metrics holds a set of file-target metrics. When registry is nil, the
+// metrics are still created but not registered, so tests that don't care
+// about metrics don't need a registry.
+type Metrics struct {
+	reg prometheus.Registerer
+
+	filesActive prometheus.Gauge
+	readBytes   *prometheus.GaugeVec
+	totalBytes  *prometheus.GaugeVec
+	readLines   *prometheus.CounterVec
+}
+
+// NewMetrics creates a new set of file target metrics, registering them with
+// reg. reg may be nil, in which case metrics are still created but not
+// exposed anywhere.
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	var m Metrics
+	m.reg = reg
+
+	m.filesActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "promtail_files_active_total",
+		Help: "Number of active files.",
+	})
+	m.readBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "promtail_read_bytes_total",
+		Help: "Number of bytes read.",
+	}, []string{"path"})
+	m.totalBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "promtail_file_bytes_total",
+		Help: "Size of files being tailed.",
+	}, []string{"path"})
+	m.readLines = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "promtail_read_lines_total",
+		Help: "Number of lines read.",
+	}, []string{"path"})
+
+	if reg != nil {
+		reg.MustRegister(m.filesActive, m.readBytes, m.totalBytes, m.readLines)
+		registerOrReuse(reg, watcherModeGauge)
+	}
+
+	return &m
+}
+
+// registerOrReuse registers c with reg, tolerating the case where an
+// equivalent collector (e.g. watcherModeGauge, which is process-global) was
+// already registered by an earlier FileTarget sharing the same registry.
+func registerOrReuse(reg prometheus.Registerer, c prometheus.Collector) {
+	if err := reg.Register(c); err != nil {
+		if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+			panic(err)
+		}
+	}
+}
+
+// watcherModeGauge reports which watcher mode (fsnotify=0, poll=1) is
+// currently active for a given watched directory, so operators can verify
+// which mode won when WatcherMode is "auto". This is a package-level
+// collector (rather than a Metrics field) because it's registered once per
+// process, not per FileTarget instance.
+var watcherModeGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "promtail_file_watcher_mode",
+	Help: "Which watcher mode (0=fsnotify, 1=poll) is active for a watched directory.",
+}, []string{"dir"})
+
+func watcherModeValue(mode WatcherMode) float64 {
+	if mode == WatcherModePoll {
+		return 1
+	}
+	return 0
+}
+
+// Snapshot implements MetricsSource, giving an Exporter a point-in-time read
+// of the counters/gauges an operator would otherwise have to scrape.
+func (m *Metrics) Snapshot() []MetricSample {
+	var samples []MetricSample
+	samples = append(samples, MetricSample{Name: "promtail_files_active_total", Value: readGauge(m.filesActive)})
+	samples = append(samples, snapshotVec("promtail_read_lines_total", m.readLines)...)
+	samples = append(samples, snapshotVec("promtail_read_bytes_total", m.readBytes)...)
+	samples = append(samples, snapshotVec("promtail_file_bytes_total", m.totalBytes)...)
+	return samples
+}
+
+func readGauge(g prometheus.Gauge) float64 {
+	var m dto.Metric
+	if err := g.Write(&m); err != nil {
+		return 0
+	}
+	return m.GetGauge().GetValue()
+}
+
+// snapshotVec collects every child time series of a GaugeVec/CounterVec into
+// MetricSamples, keyed by their "path" label.
+func snapshotVec(name string, c prometheus.Collector) []MetricSample {
+	ch := make(chan prometheus.Metric, 64)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+
+	var samples []MetricSample
+	for metric := range ch {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			continue
+		}
+		labels := make(map[string]string, len(m.GetLabel()))
+		for _, l := range m.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		value := m.GetGauge().GetValue()
+		if m.GetCounter() != nil {
+			value = m.GetCounter().GetValue()
+		}
+		samples = append(samples, MetricSample{Name: name, Labels: labels, Value: value})
+	}
+	return samples
+}
@@ -0,0 +1,153 @@
+package file
+
+import (
+	"os"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/tail"
+
+	"github.com/grafana/loki/clients/pkg/promtail/api"
+	"github.com/grafana/loki/clients/pkg/promtail/positions"
+)
+
+// Reader is an interface that wraps the common methods used to read and
+// manage log tailers within a FileTarget.
+type Reader interface {
+	Stop()
+	IsRunning() bool
+	Path() string
+}
+
+// tailer tails a single file, forwarding each line read to the configured
+// api.EntryHandler and periodically persisting its position.
+type tailer struct {
+	metrics   *Metrics
+	logger    log.Logger
+	handler   api.EntryHandler
+	positions positions.Positions
+
+	path string
+	tail *tail.Tail
+
+	running       int32
+	posdone       chan struct{}
+	done          chan struct{}
+	posQuit       chan struct{}
+	posSyncPeriod time.Duration
+}
+
+func newTailer(metrics *Metrics, logger log.Logger, handler api.EntryHandler, positions positions.Positions, path string, encoding string) (*tailer, error) {
+	tailConf := tail.Config{
+		Follow: true,
+		Poll:   true,
+		ReOpen: true,
+		Location: &tail.SeekInfo{
+			Offset: 0,
+			Whence: 0,
+		},
+	}
+
+	tail, err := tail.TailFile(path, tailConf)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &tailer{
+		metrics:       metrics,
+		logger:        logger,
+		handler:       handler,
+		positions:     positions,
+		path:          path,
+		tail:          tail,
+		done:          make(chan struct{}),
+		posdone:       make(chan struct{}),
+		posQuit:       make(chan struct{}),
+		posSyncPeriod: 250 * time.Millisecond,
+		running:       1,
+	}
+
+	go t.readLines()
+	go t.updatePosition()
+
+	return t, nil
+}
+
+func (t *tailer) readLines() {
+	defer close(t.done)
+	defer level.Info(t.logger).Log("msg", "tail routine: exited", "path", t.path)
+
+	for line := range t.tail.Lines {
+		if line.Err != nil {
+			level.Error(t.logger).Log("msg", "error reading line", "path", t.path, "error", line.Err)
+		}
+
+		t.handler.Chan() <- api.Entry{
+			Line:      line.Text,
+			Timestamp: time.Now(),
+		}
+
+		t.metrics.readLines.WithLabelValues(t.path).Inc()
+		t.metrics.readBytes.WithLabelValues(t.path).Add(float64(len(line.Text) + 1))
+	}
+}
+
+func (t *tailer) updatePosition() {
+	positionSyncPeriod := t.posSyncPeriod
+	positionWait := time.NewTicker(positionSyncPeriod)
+	defer func() {
+		positionWait.Stop()
+		t.cleanupMetrics()
+		close(t.posdone)
+	}()
+
+	for {
+		select {
+		case <-positionWait.C:
+			if err := t.markPosition(); err != nil {
+				level.Error(t.logger).Log("msg", "error marking position", "path", t.path, "error", err)
+			}
+		case <-t.posQuit:
+			return
+		}
+	}
+}
+
+func (t *tailer) markPosition() error {
+	pos, err := t.tail.Tell()
+	if err != nil {
+		return err
+	}
+	t.positions.Put(t.path, pos)
+
+	if fi, err := os.Stat(t.path); err == nil {
+		t.metrics.totalBytes.WithLabelValues(t.path).Set(float64(fi.Size()))
+	}
+	return nil
+}
+
+func (t *tailer) cleanupMetrics() {
+	t.metrics.readLines.DeleteLabelValues(t.path)
+	t.metrics.readBytes.DeleteLabelValues(t.path)
+	t.metrics.totalBytes.DeleteLabelValues(t.path)
+}
+
+// Stop stops the tailer and waits for its background goroutines to exit.
+func (t *tailer) Stop() {
+	_ = t.tail.Stop()
+	<-t.done
+	close(t.posQuit)
+	<-t.posdone
+	t.positions.Remove(t.path)
+}
+
+// IsRunning reports whether the underlying tail routine is still alive.
+func (t *tailer) IsRunning() bool {
+	return !t.tail.Tomb.IsDone()
+}
+
+// Path returns the path being tailed.
+func (t *tailer) Path() string {
+	return t.path
+}
@@ -0,0 +1,31 @@
+package file
+
+// toStopTailing returns the paths present in existingTails but absent from
+// nextTails -- i.e. the tailers that are no longer matched and should be
+// stopped.
+func toStopTailing(nextTails []string, existingTails map[string]Reader) []string {
+	// Make a set of the paths we still want to be tailing for fast lookup below.
+	nextSet := make(map[string]struct{}, len(nextTails))
+	for _, p := range nextTails {
+		nextSet[p] = struct{}{}
+	}
+
+	ts := make([]string, 0, len(existingTails))
+	for p := range existingTails {
+		if _, ok := nextSet[p]; !ok {
+			ts = append(ts, p)
+		}
+	}
+	return ts
+}
+
+// missing returns the entries present in b but absent from a.
+func missing(a map[string]struct{}, b map[string]struct{}) map[string]struct{} {
+	c := map[string]struct{}{}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			c[k] = struct{}{}
+		}
+	}
+	return c
+}
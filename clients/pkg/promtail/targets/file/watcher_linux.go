@@ -0,0 +1,44 @@
+//go:build linux
+
+package file
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Filesystem magic numbers for mounts known to drop or never deliver
+// inotify events, from linux/magic.h.
+const (
+	nfsSuperMagic       = 0x6969
+	smbSuperMagic       = 0x517B
+	cifsSuperMagic      = 0xFF534D42
+	fuseSuperMagic      = 0x65735546
+	overlayfsSuperMagic = 0x794C7630
+)
+
+// isUnreliableNotifyFilesystem reports whether dir is backed by a filesystem
+// type where inotify events are known to be unreliable or unsupported, by
+// inspecting statfs(2)'s f_type.
+func isUnreliableNotifyFilesystem(dir string) bool {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(dir, &stat); err != nil {
+		return false
+	}
+
+	switch int64(stat.Type) {
+	case nfsSuperMagic, smbSuperMagic, cifsSuperMagic, fuseSuperMagic, overlayfsSuperMagic:
+		return true
+	default:
+		return false
+	}
+}
+
+func inodeOf(info os.FileInfo) uint64 {
+	if sys, ok := info.Sys().(*syscall.Stat_t); ok {
+		return sys.Ino
+	}
+	return 0
+}
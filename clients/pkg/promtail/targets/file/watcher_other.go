@@ -0,0 +1,18 @@
+//go:build !linux
+
+package file
+
+import "os"
+
+// isUnreliableNotifyFilesystem always returns false on non-Linux platforms:
+// statfs-based detection of NFS/CIFS/FUSE/overlayfs mounts is Linux-specific,
+// so "auto" mode behaves like "fsnotify" elsewhere. Operators on these
+// platforms who know they're on an unreliable mount can still set
+// WatcherMode to "poll" explicitly.
+func isUnreliableNotifyFilesystem(dir string) bool {
+	return false
+}
+
+func inodeOf(info os.FileInfo) uint64 {
+	return 0
+}
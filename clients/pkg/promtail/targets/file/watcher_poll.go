@@ -0,0 +1,134 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// dirEntrySnapshot is the subset of file metadata dirPoller uses to detect
+// creates, removes, renames and writes between two listings of a directory.
+type dirEntrySnapshot struct {
+	size  int64
+	mtime time.Time
+	inode uint64
+}
+
+// dirPoller periodically lists a directory with os.ReadDir (and each entry's
+// Info) and diffs the result against its previous snapshot, synthesizing the same
+// fsnotify.Event values that fsnotify itself would deliver. It exists so
+// that directories on filesystems where inotify/kqueue events are dropped
+// or never arrive (NFS, CIFS, FUSE, overlayfs) can still be watched.
+type dirPoller struct {
+	logger   log.Logger
+	dir      string
+	interval time.Duration
+	events   chan<- fsnotify.Event
+
+	snapshot map[string]dirEntrySnapshot
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+func newDirPoller(logger log.Logger, dir string, interval time.Duration, events chan<- fsnotify.Event) *dirPoller {
+	if interval <= 0 {
+		interval = DefaultWatchConig.PollingInterval
+	}
+	return &dirPoller{
+		logger:   logger,
+		dir:      dir,
+		interval: interval,
+		events:   events,
+		snapshot: map[string]dirEntrySnapshot{},
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start begins polling dir on its own goroutine. The initial listing is
+// taken synchronously so the first poll tick only reports genuine changes.
+func (p *dirPoller) Start() {
+	p.poll(false)
+	go p.run()
+}
+
+func (p *dirPoller) Stop() {
+	close(p.quit)
+	<-p.done
+}
+
+func (p *dirPoller) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.poll(true)
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+func (p *dirPoller) poll(emit bool) {
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		level.Warn(p.logger).Log("msg", "polling watcher failed to list directory", "dir", p.dir, "error", err)
+		return
+	}
+
+	seen := make(map[string]dirEntrySnapshot, len(entries))
+	for _, entry := range entries {
+		path := filepath.Join(p.dir, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		snap := dirEntrySnapshot{
+			size:  info.Size(),
+			mtime: info.ModTime(),
+			inode: inodeOf(info),
+		}
+		seen[path] = snap
+
+		prev, existed := p.snapshot[path]
+		if !existed {
+			p.emit(emit, fsnotify.Event{Name: path, Op: fsnotify.Create})
+			continue
+		}
+		if prev.inode != snap.inode {
+			// Same name, different inode: treated as a rename away followed
+			// by a new file taking the old name.
+			p.emit(emit, fsnotify.Event{Name: path, Op: fsnotify.Rename})
+			p.emit(emit, fsnotify.Event{Name: path, Op: fsnotify.Create})
+			continue
+		}
+		if prev.size != snap.size || !prev.mtime.Equal(snap.mtime) {
+			p.emit(emit, fsnotify.Event{Name: path, Op: fsnotify.Write})
+		}
+	}
+
+	for path := range p.snapshot {
+		if _, ok := seen[path]; !ok {
+			p.emit(emit, fsnotify.Event{Name: path, Op: fsnotify.Remove})
+		}
+	}
+
+	p.snapshot = seen
+}
+
+func (p *dirPoller) emit(emit bool, ev fsnotify.Event) {
+	if !emit || p.events == nil {
+		return
+	}
+	select {
+	case p.events <- ev:
+	case <-p.quit:
+	}
+}
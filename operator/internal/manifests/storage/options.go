@@ -54,6 +54,11 @@ func (o Options) CredentialMode() lokiv1.CredentialMode {
 		}
 	}
 
+	// Swift.WorkloadIdentity and AlibabaCloud.RAMRole are not checked here:
+	// nothing in this package projects a service-account token or exchanges
+	// it at startup for these two providers, so both report
+	// CredentialModeStatic whether or not those fields are set.
+
 	return lokiv1.CredentialModeStatic
 }
 
@@ -78,10 +83,28 @@ type GCSStorageConfig struct {
 type S3StorageConfig struct {
 	Endpoint string
 	Region   string
+	// Buckets is the comma-separated bucket list existing config-rendering
+	// code already parses. Left as-is (not replaced in place) because
+	// changing its type would be a breaking change for callers outside this
+	// tree slice that still treat it as a string.
 	Buckets  string
 	Audience string
 	STS      bool
 	SSE      S3SSEConfig
+
+	// PerBucketSSE lists buckets that each carry their own SSE policy in
+	// place of the top-level SSE (e.g. cold tenants in an SSE-S3 bucket,
+	// regulated tenants in an SSE-KMS or SSE-C one). Buckets named here are
+	// expected to also appear in Buckets. This package only carries the data:
+	// nothing in it reads PerBucketSSE or renders a per-bucket sse stanza.
+	PerBucketSSE []S3Bucket
+}
+
+// S3Bucket names a single bucket and the SSE policy that overrides it, for
+// use in S3StorageConfig.PerBucketSSE.
+type S3Bucket struct {
+	Name string
+	SSE  S3SSEConfig
 }
 
 type S3SSEType string
@@ -89,12 +112,23 @@ type S3SSEType string
 const (
 	SSEKMSType S3SSEType = "SSE-KMS"
 	SSES3Type  S3SSEType = "SSE-S3"
+	// SSECType is customer-provided server-side encryption: the client
+	// supplies the encryption key on every request rather than having S3 or
+	// KMS manage it.
+	SSECType S3SSEType = "SSE-C"
 )
 
 type S3SSEConfig struct {
 	Type                 S3SSEType
 	KMSKeyID             string
 	KMSEncryptionContext string
+
+	// CustomerKeySecretRef names the Kubernetes secret holding the 32-byte
+	// customer-provided key and its MD5, for use when Type is SSECType. This
+	// package only carries the reference: nothing in it reads the secret or
+	// sets the X-Amz-Server-Side-Encryption-Customer-Key(-MD5) request
+	// headers from it.
+	CustomerKeySecretRef string
 }
 
 // SwiftStorageConfig for Swift storage config
@@ -111,12 +145,36 @@ type SwiftStorageConfig struct {
 	ProjectDomainName string
 	Region            string
 	Container         string
+
+	// ApplicationCredentialID and ApplicationCredentialSecret authenticate
+	// against Keystone's application_credential auth plugin. Mutually
+	// exclusive with WorkloadIdentity.
+	ApplicationCredentialID     string
+	ApplicationCredentialSecret string
+
+	// WorkloadIdentity selects keyless auth via Keystone's openid auth
+	// plugin, federating the cluster's OIDC provider through
+	// application_credential. CredentialMode() does not read it and reports
+	// CredentialModeStatic for Swift whether or not it is set; nothing in
+	// this package projects a service-account token or exchanges it with
+	// Keystone.
+	WorkloadIdentity bool
 }
 
 // AlibabaCloudStorageConfig for AlibabaCloud storage config
 type AlibabaCloudStorageConfig struct {
 	Endpoint string
 	Bucket   string
+
+	// RAMRole, OIDCProviderARN and OIDCTokenFile describe RAM Roles for
+	// Service Accounts (RRSA): exchanging a projected Kubernetes
+	// service-account token for temporary RAM credentials instead of a static
+	// AccessKey/SecretKey pair. CredentialMode() does not read them and
+	// reports CredentialModeStatic for AlibabaCloud whether or not they are
+	// set; nothing in this package projects or mounts that token.
+	RAMRole         string
+	OIDCProviderARN string
+	OIDCTokenFile   string
 }
 
 // TLSConfig for object storage endpoints. Currently supported only by: